@@ -0,0 +1,197 @@
+package goose
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChecksumPolicy controls how goose reacts when a previously-applied
+// migration's checksum no longer matches the Up SQL on disk.
+type ChecksumPolicy int
+
+const (
+	// ChecksumOff skips checksum recording and verification entirely.
+	// This is the default so upgrading goose doesn't break deployments
+	// whose goose_db_version table hasn't been migrated to add the
+	// checksum column yet.
+	ChecksumOff ChecksumPolicy = iota
+	// ChecksumWarn logs a warning when a checksum has drifted, but
+	// continues running.
+	ChecksumWarn
+	// ChecksumStrict fails the run when a checksum has drifted.
+	ChecksumStrict
+)
+
+// checksumPolicy is the active policy.
+var checksumPolicy = ChecksumOff
+
+// SetChecksumPolicy configures how goose reacts to drift between a
+// migration's checksum at apply time and its checksum now.
+func SetChecksumPolicy(p ChecksumPolicy) {
+	checksumPolicy = p
+}
+
+// ChecksumRecorder is implemented by dialects that can store a
+// migration's checksum in a checksum column of the goose_db_version
+// table. Implementing it says nothing about whether that column exists
+// yet; EnsureChecksumColumn adds it. For a dialect that does not
+// implement it, checksums are never recorded or added as a column.
+type ChecksumRecorder interface {
+	// updateChecksumSQL returns the statement that stamps the checksum
+	// column for the row inserted by insertVersionSQL. It runs
+	// immediately after that insert, in the same transaction when the
+	// migration runs in one.
+	updateChecksumSQL() string
+	// addChecksumColumnSQL returns the ALTER TABLE statement that adds
+	// the checksum column to an existing goose_db_version table created
+	// before this feature existed.
+	addChecksumColumnSQL() string
+}
+
+// checksumRecorder returns the active dialect as a ChecksumRecorder,
+// but only when checksumPolicy has been turned on. Every dialect
+// implements ChecksumRecorder, so gating on the type assertion alone
+// would run the checksum UPDATE even under the ChecksumOff default,
+// against a goose_db_version table whose checksum column may not exist
+// yet (it's added by the separate EnsureChecksumColumn, which callers
+// are expected to run before turning the policy on). Call sites that
+// record a checksum should go through this instead of asserting
+// ChecksumRecorder directly.
+func checksumRecorder() (ChecksumRecorder, bool) {
+	if checksumPolicy == ChecksumOff {
+		return nil, false
+	}
+	recorder, ok := GetDialect().(ChecksumRecorder)
+	return recorder, ok
+}
+
+func (PostgresDialect) updateChecksumSQL() string {
+	return fmt.Sprintf("UPDATE %s SET checksum = $1 WHERE version_id = $2", tableName)
+}
+
+func (PostgresDialect) addChecksumColumnSQL() string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN checksum text", tableName)
+}
+
+func (MySQLDialect) updateChecksumSQL() string {
+	return fmt.Sprintf("UPDATE %s SET checksum = ? WHERE version_id = ?", tableName)
+}
+
+func (MySQLDialect) addChecksumColumnSQL() string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN checksum varchar(64)", tableName)
+}
+
+func (Sqlite3Dialect) updateChecksumSQL() string {
+	return fmt.Sprintf("UPDATE %s SET checksum = ? WHERE version_id = ?", tableName)
+}
+
+func (Sqlite3Dialect) addChecksumColumnSQL() string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN checksum text", tableName)
+}
+
+// duplicateColumnMarkers are substrings of the "column already exists"
+// error each driver returns for a repeated ALTER TABLE ADD COLUMN. There
+// is no portable sentinel error for this across database/sql drivers,
+// so EnsureChecksumColumn matches on these instead of introspecting the
+// schema up front.
+var duplicateColumnMarkers = []string{
+	"already exists",   // postgres
+	"duplicate column", // mysql, sqlite (case-insensitive match below)
+}
+
+// EnsureChecksumColumn adds the checksum column to the goose_db_version
+// table if the active dialect supports checksumming and the column
+// isn't already there. It's safe to call on every startup: schemas that
+// already have the column, and dialects that don't support checksums at
+// all, are both left untouched.
+func EnsureChecksumColumn(db *sql.DB) error {
+	recorder, ok := GetDialect().(ChecksumRecorder)
+	if !ok {
+		return nil
+	}
+
+	_, err := db.Exec(recorder.addChecksumColumnSQL())
+	if err == nil {
+		return nil
+	}
+
+	lower := strings.ToLower(err.Error())
+	for _, marker := range duplicateColumnMarkers {
+		if strings.Contains(lower, marker) {
+			return nil
+		}
+	}
+
+	return errors.Wrap(err, "failed to add checksum column to goose version table")
+}
+
+// checksumStatements hashes the cleaned, normalized SQL text of a set of
+// Up statements. It's computed identically at apply time and at
+// drift-check time, so whitespace or comment-only edits that
+// clearStatement already strips don't trigger a false mismatch.
+func checksumStatements(statements []Statement) string {
+	h := sha256.New()
+	for _, s := range statements {
+		h.Write([]byte(clearStatement(s.SQL)))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// verifyChecksum compares a recorded checksum against the current Up
+// statements for an already-applied migration, applying checksumPolicy
+// to decide whether drift is fatal, a warning, or ignored.
+func verifyChecksum(version int64, recorded string, statements []Statement) error {
+	if checksumPolicy == ChecksumOff || recorded == "" {
+		return nil
+	}
+
+	got := checksumStatements(statements)
+	if got == recorded {
+		return nil
+	}
+
+	switch checksumPolicy {
+	case ChecksumStrict:
+		return errors.Errorf("checksum mismatch for migration %d: recorded %s, got %s (file edited after being applied?)", version, recorded, got)
+	case ChecksumWarn:
+		gooseLog.Printf("goose: checksum mismatch for migration %d: recorded %s, got %s (file edited after being applied?)\n", version, recorded, got)
+	}
+
+	return nil
+}
+
+// AppliedMigration pairs an already-applied migration's recorded
+// checksum with the Up statements currently on disk for that version,
+// so CheckChecksums can tell whether the file has drifted since it was
+// applied.
+type AppliedMigration struct {
+	Version    int64
+	Checksum   string
+	Statements []Statement
+}
+
+// CheckChecksums is the integration point Up and Status call, before
+// doing anything else, to recompute the checksum of every
+// already-applied migration and compare it against what was recorded
+// when it was applied. It honors checksumPolicy: under ChecksumStrict
+// the first mismatch aborts the run; under ChecksumWarn every mismatch
+// is logged but the run proceeds; under ChecksumOff (the default) it's
+// a no-op.
+func CheckChecksums(applied []AppliedMigration) error {
+	if checksumPolicy == ChecksumOff {
+		return nil
+	}
+
+	for _, m := range applied {
+		if err := verifyChecksum(m.Version, m.Checksum, m.Statements); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package goose
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// SQLDialect abstracts the SQL differences between the database engines
+// goose supports. GetDialect/SetDialect select the active one; every
+// call site that needs engine-specific SQL goes through it rather than
+// branching on a dialect name string.
+type SQLDialect interface {
+	createVersionTableSQL() string
+	insertVersionSQL() string
+	deleteVersionSQL() string
+	dbVersionQuery(db *sql.DB) (*sql.Rows, error)
+}
+
+var dialect SQLDialect = &PostgresDialect{}
+
+// GetDialect returns the currently configured SQLDialect.
+func GetDialect() SQLDialect {
+	return dialect
+}
+
+// SetDialect configures the dialect goose uses for version-table SQL,
+// locking, and checksumming. Supported names are "postgres", "mysql"
+// and "sqlite3".
+func SetDialect(name string) error {
+	switch name {
+	case "postgres":
+		dialect = &PostgresDialect{}
+	case "mysql":
+		dialect = &MySQLDialect{}
+	case "sqlite3":
+		dialect = &Sqlite3Dialect{}
+	default:
+		return errors.Errorf("%q: unknown dialect", name)
+	}
+	return nil
+}
+
+// tableName is the name of the table goose uses to track applied
+// migrations, "goose_db_version" by default.
+var tableName = "goose_db_version"
+
+// TableName returns the name of the goose version table.
+func TableName() string {
+	return tableName
+}
+
+// SetTableName overrides the name of the goose version table, so
+// multiple goose-managed schemas can coexist in one database.
+func SetTableName(n string) {
+	tableName = n
+}
+
+// PostgresDialect is the SQLDialect for Postgres and Postgres-compatible
+// databases.
+type PostgresDialect struct{}
+
+func (PostgresDialect) createVersionTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+		id serial NOT NULL,
+		version_id bigint NOT NULL,
+		is_applied boolean NOT NULL,
+		tstamp timestamp NULL default now(),
+		PRIMARY KEY(id)
+	)`, tableName)
+}
+
+func (PostgresDialect) insertVersionSQL() string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES ($1, $2)", tableName)
+}
+
+func (PostgresDialect) deleteVersionSQL() string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=$1", tableName)
+}
+
+func (PostgresDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
+	return db.Query(fmt.Sprintf("SELECT version_id, is_applied FROM %s ORDER BY id DESC", tableName))
+}
+
+// MySQLDialect is the SQLDialect for MySQL and MySQL-compatible
+// databases.
+type MySQLDialect struct{}
+
+func (MySQLDialect) createVersionTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+		id serial NOT NULL,
+		version_id bigint NOT NULL,
+		is_applied boolean NOT NULL,
+		tstamp timestamp NULL default now(),
+		PRIMARY KEY(id)
+	)`, tableName)
+}
+
+func (MySQLDialect) insertVersionSQL() string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?)", tableName)
+}
+
+func (MySQLDialect) deleteVersionSQL() string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?", tableName)
+}
+
+func (MySQLDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
+	return db.Query(fmt.Sprintf("SELECT version_id, is_applied FROM %s ORDER BY id DESC", tableName))
+}
+
+// Sqlite3Dialect is the SQLDialect for SQLite.
+type Sqlite3Dialect struct{}
+
+func (Sqlite3Dialect) createVersionTableSQL() string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	)`, tableName)
+}
+
+func (Sqlite3Dialect) insertVersionSQL() string {
+	return fmt.Sprintf("INSERT INTO %s (version_id, is_applied) VALUES (?, ?)", tableName)
+}
+
+func (Sqlite3Dialect) deleteVersionSQL() string {
+	return fmt.Sprintf("DELETE FROM %s WHERE version_id=?", tableName)
+}
+
+func (Sqlite3Dialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
+	return db.Query(fmt.Sprintf("SELECT version_id, is_applied FROM %s ORDER BY id DESC", tableName))
+}
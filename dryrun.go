@@ -0,0 +1,50 @@
+package goose
+
+import "context"
+
+// dryRun, when enabled, makes runSQLMigrationContext print the SQL it
+// would execute instead of touching the database.
+var dryRun bool
+
+// SetDryRun toggles dry-run / plan mode. While enabled, migrations are
+// never applied: runSQLMigrationContext logs each statement it would run,
+// plus the version-table bookkeeping, and returns without opening a
+// transaction or calling Exec. This is the feature embedders otherwise
+// keep reinventing when they want to show an operator what a migration
+// will do before committing to it.
+func SetDryRun(enabled bool) {
+	dryRun = enabled
+}
+
+// planSQLMigration logs the SQL that runSQLMigrationContext would
+// execute for this migration, without opening a transaction or issuing
+// any statement against db. It is used in place of the real execution
+// path when dry-run mode is enabled via SetDryRun.
+func planSQLMigration(ctx context.Context, statements []Statement, useTx bool, v int64, direction bool, noVersioning bool) error {
+	dir := "down"
+	if direction {
+		dir = "up"
+	}
+	gooseLog.Printf("-- plan: version %d (%s), tx=%t\n", v, dir, useTx)
+
+	for _, stmt := range statements {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if stmt.NoTx {
+			gooseLog.Printf("-- +goose NO TRANSACTION\n%s\n", clearStatement(stmt.SQL))
+			continue
+		}
+		gooseLog.Printf("%s\n", clearStatement(stmt.SQL))
+	}
+
+	if !noVersioning {
+		if direction {
+			gooseLog.Printf("%s -- args: %d, %t\n", clearStatement(GetDialect().insertVersionSQL()), v, direction)
+		} else {
+			gooseLog.Printf("%s -- args: %d\n", clearStatement(GetDialect().deleteVersionSQL()), v)
+		}
+	}
+
+	return nil
+}
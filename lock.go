@@ -0,0 +1,186 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Locker is implemented by dialects that support a cross-session
+// advisory lock scoped to an entire migration run. It lets multiple
+// goose-driven processes that boot concurrently (e.g. a Kubernetes
+// rollout of several replicas of the same service) avoid racing each
+// other on the version table.
+//
+// Lock and Unlock must be called on the same connection: Postgres and
+// MySQL session-scoped advisory locks are tied to the connection that
+// took them, so Lock pins one out of the pool and hands it back for
+// Unlock to release and close.
+type Locker interface {
+	// Lock opens a connection, acquires the advisory lock identified by
+	// key on it, and returns that connection. It blocks until the lock
+	// is held or timeout elapses; timeout <= 0 blocks forever.
+	Lock(ctx context.Context, db *sql.DB, key uint32, timeout time.Duration) (*sql.Conn, error)
+	// Unlock releases the lock held on conn and is responsible for
+	// closing conn once it no longer needs to be pinned.
+	Unlock(ctx context.Context, conn *sql.Conn, key uint32) error
+}
+
+// lockTimeout bounds how long runSQLMigrationContext waits to acquire
+// the advisory lock before giving up. Zero, the default, blocks forever.
+var lockTimeout time.Duration
+
+// WithLockTimeout configures how long goose waits to acquire the
+// cross-session advisory lock before failing. CI jobs that would rather
+// fail fast than hang behind a stuck migration should set this.
+func WithLockTimeout(d time.Duration) {
+	lockTimeout = d
+}
+
+// lockKey derives a stable advisory-lock key from the migration table
+// name, so that multiple goose-managed schemas sharing one database
+// don't block on each other's migrations.
+func lockKey(tableName string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(tableName))
+	return h.Sum32()
+}
+
+// acquireLock takes the current dialect's advisory lock, if the dialect
+// implements Locker. Dialects that don't support advisory locking yet
+// are a no-op, preserving goose's historical behavior of racing on the
+// version table.
+func acquireLock(ctx context.Context, db *sql.DB) (release func() error, err error) {
+	locker, ok := GetDialect().(Locker)
+	if !ok {
+		return func() error { return nil }, nil
+	}
+
+	key := lockKey(TableName())
+	conn, err := locker.Lock(ctx, db, key, lockTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to acquire goose advisory lock")
+	}
+
+	return func() error {
+		return locker.Unlock(ctx, conn, key)
+	}, nil
+}
+
+// pollInterval is how often Lock retries a try-lock while waiting for
+// one held by another session to free up.
+const pollInterval = 100 * time.Millisecond
+
+// withLockDeadline applies timeout to ctx, if set, and returns the
+// resulting context along with its cancel func.
+func withLockDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Lock acquires a Postgres session-level advisory lock on a dedicated
+// connection pinned out of db's pool, using pg_try_advisory_lock in a
+// poll loop so WithLockTimeout can make CI jobs fail fast instead of
+// blocking on pg_advisory_lock indefinitely.
+func (PostgresDialect) Lock(ctx context.Context, db *sql.DB, key uint32, timeout time.Duration) (*sql.Conn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open connection for advisory lock")
+	}
+
+	ctx, cancel := withLockDeadline(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, "select pg_try_advisory_lock($1)", int64(int32(key))).Scan(&locked); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if locked {
+			return conn, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, errors.Wrap(ctx.Err(), "timed out waiting for postgres advisory lock")
+		case <-ticker.C:
+		}
+	}
+}
+
+// Unlock releases the Postgres advisory lock held on conn and closes
+// the connection.
+func (PostgresDialect) Unlock(ctx context.Context, conn *sql.Conn, key uint32) error {
+	defer conn.Close()
+	_, err := conn.ExecContext(ctx, "select pg_advisory_unlock($1)", int64(int32(key)))
+	return err
+}
+
+// Lock acquires a MySQL named lock via GET_LOCK on a dedicated
+// connection pinned out of db's pool. GET_LOCK's own timeout argument
+// (in whole seconds; -1 means wait forever) does the waiting, so no
+// poll loop is needed here.
+func (MySQLDialect) Lock(ctx context.Context, db *sql.DB, key uint32, timeout time.Duration) (*sql.Conn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open connection for advisory lock")
+	}
+
+	seconds := -1
+	if timeout > 0 {
+		seconds = int(timeout / time.Second)
+		if seconds < 1 {
+			seconds = 1
+		}
+	}
+
+	name := mysqlLockName(key)
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "select GET_LOCK(?, ?)", name, seconds).Scan(&got); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		conn.Close()
+		return nil, errors.Errorf("timed out waiting for mysql advisory lock %q", name)
+	}
+
+	return conn, nil
+}
+
+// Unlock releases the MySQL named lock held on conn via RELEASE_LOCK
+// and closes the connection.
+func (MySQLDialect) Unlock(ctx context.Context, conn *sql.Conn, key uint32) error {
+	defer conn.Close()
+	_, err := conn.ExecContext(ctx, "select RELEASE_LOCK(?)", mysqlLockName(key))
+	return err
+}
+
+func mysqlLockName(key uint32) string {
+	return fmt.Sprintf("goose:%d", key)
+}
+
+// Sqlite3Dialect deliberately does not implement Locker. A BEGIN
+// IMMEDIATE sentinel held open on a connection pinned out of the pool
+// (as used for Postgres and MySQL above) would reserve the database for
+// writing on that connection, while the migration itself still runs on
+// a separate pooled connection via db.BeginTx/db.ExecContext in
+// runSQLMigrationContext — so the migration's own writes would block on
+// the lock it's supposed to be protected by, deadlocking every run.
+// SQLite has no cross-connection advisory lock primitive to fall back
+// to instead, so acquireLock's no-op path is what runs for this
+// dialect: callers that need to serialize concurrent goose runs against
+// SQLite should call db.SetMaxOpenConns(1) themselves, which gives the
+// same effect at the connection-pool level without goose needing to
+// hold a competing transaction open.
@@ -0,0 +1,100 @@
+package goose
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Logger is the logging sink used by goose for progress and diagnostic
+// output. Embedders that run goose as a library (rather than the CLI)
+// can call SetLogger to route this output wherever they like instead of
+// the package-level default, which writes to os.Stderr.
+type Logger interface {
+	Printf(format string, v ...interface{})
+	Fatalf(format string, v ...interface{})
+}
+
+// gooseLog is the active Logger. It defaults to a colorized logger that
+// only emits color codes when attached to a terminal.
+var gooseLog Logger = newDefaultLogger()
+
+// SetLogger replaces the package-level Logger used by goose. Passing
+// NopLogger() silences goose entirely, which is useful for embedders
+// that don't want migration chatter mixed into their own logs.
+func SetLogger(l Logger) {
+	if l == nil {
+		panic("goose: nil logger")
+	}
+	gooseLog = l
+}
+
+const (
+	grayColor  = "\033[90m"
+	resetColor = "\033[00m"
+)
+
+// defaultLogger is the out-of-the-box Logger, preserved for backwards
+// compatibility with goose's historical gray, timestamped output when
+// run from a terminal. It degrades to plain, uncolored output when
+// stderr isn't a TTY (e.g. redirected to a file or a CI log).
+type defaultLogger struct {
+	*log.Logger
+	colorize bool
+}
+
+func newDefaultLogger() *defaultLogger {
+	return &defaultLogger{
+		Logger:   log.New(os.Stderr, "", log.LstdFlags),
+		colorize: isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd()),
+	}
+}
+
+func (l *defaultLogger) Printf(format string, v ...interface{}) {
+	if l.colorize {
+		format = grayColor + format + resetColor
+	}
+	l.Logger.Printf(format, v...)
+}
+
+func (l *defaultLogger) Fatalf(format string, v ...interface{}) {
+	if l.colorize {
+		format = grayColor + format + resetColor
+	}
+	l.Logger.Fatalf(format, v...)
+}
+
+// nopLogger discards everything written to it.
+type nopLogger struct{}
+
+// NopLogger returns a Logger that discards all output. Useful for
+// embedders that want goose to run quietly.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Printf(string, ...interface{}) {}
+func (nopLogger) Fatalf(string, ...interface{}) {}
+
+// slogLogger adapts an *slog.Logger to the goose Logger interface.
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger wraps l so it can be passed to SetLogger, letting
+// embedders fold goose's output into their own structured logging.
+func NewSlogLogger(l *slog.Logger) Logger {
+	return &slogLogger{l: l}
+}
+
+func (s *slogLogger) Printf(format string, v ...interface{}) {
+	s.l.Info(fmt.Sprintf(format, v...))
+}
+
+func (s *slogLogger) Fatalf(format string, v ...interface{}) {
+	s.l.Error(fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
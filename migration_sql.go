@@ -1,6 +1,7 @@
 package goose
 
 import (
+	"context"
 	"database/sql"
 	"regexp"
 	"time"
@@ -8,6 +9,20 @@ import (
 	"github.com/pkg/errors"
 )
 
+// statementTimeout bounds how long a single statement is allowed to run
+// before execQueryContext gives up waiting on it. Zero means no timeout,
+// which is the default so existing callers see no behavior change.
+var statementTimeout time.Duration
+
+// SetStatementTimeout configures a per-statement timeout applied by
+// runSQLMigrationContext and execQueryContext. A zero duration (the
+// default) disables the timeout. This is independent of any deadline
+// already present on the context passed in by the caller; whichever
+// fires first wins.
+func SetStatementTimeout(d time.Duration) {
+	statementTimeout = d
+}
+
 // Run a migration specified in raw SQL.
 //
 // Sections of the script can be annotated with a special comment,
@@ -16,64 +31,153 @@ import (
 //
 // All statements following an Up or Down directive are grouped together
 // until another direction directive is found.
-func runSQLMigration(db *sql.DB, statements []string, useTx bool, v int64, direction bool, noVersioning bool) error {
+func runSQLMigration(db *sql.DB, statements []Statement, useTx bool, v int64, direction bool, noVersioning bool) error {
+	return runSQLMigrationContext(context.Background(), db, statements, useTx, v, direction, noVersioning)
+}
+
+// runSQLMigrationContext is the context-aware counterpart of
+// runSQLMigration. It honors ctx.Done() between statements and while
+// waiting on an in-flight statement, so embedders running goose as a
+// library inside a long-running service can cancel in-flight DDL on
+// shutdown instead of leaking goroutines.
+//
+// useTx is the file-level default, but an individual Statement marked
+// NoTx still runs directly against db even when the rest of the file
+// runs inside a transaction.
+func runSQLMigrationContext(ctx context.Context, db *sql.DB, statements []Statement, useTx bool, v int64, direction bool, noVersioning bool) error {
+	if dryRun {
+		return planSQLMigration(ctx, statements, useTx, v, direction, noVersioning)
+	}
+
+	release, err := acquireLock(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := release(); err != nil {
+			verboseInfo("failed to release goose advisory lock: %v", err)
+		}
+	}()
+
 	if useTx {
-		// TRANSACTION.
+		// TRANSACTION, but an individual Statement may still be
+		// annotated NO TRANSACTION. Statements run in segments: a run of
+		// consecutive in-tx statements shares one transaction, and each
+		// NoTx statement first commits whatever segment is open and then
+		// runs alone via autocommit. This is required for correctness,
+		// not just tidiness: Postgres refuses to run a statement like
+		// CREATE INDEX CONCURRENTLY inside any transaction block, and
+		// running it on a side connection while tx stayed open would
+		// leave that DDL applied even if tx later rolled back, so a
+		// retry would hit "already exists" on an otherwise-unapplied
+		// migration.
+		var tx *sql.Tx
+
+		beginSegment := func() error {
+			var err error
+			tx, err = db.BeginTx(ctx, nil)
+			if err != nil {
+				return errors.Wrap(err, "failed to begin transaction")
+			}
+			verboseInfo("Begin transaction")
+			return nil
+		}
 
-		verboseInfo("Begin transaction")
+		commitSegment := func() error {
+			if tx == nil {
+				return nil
+			}
+			verboseInfo("Commit transaction")
+			if err := tx.Commit(); err != nil {
+				return errors.Wrap(err, "failed to commit transaction")
+			}
+			tx = nil
+			return nil
+		}
 
-		tx, err := db.Begin()
-		if err != nil {
-			return errors.Wrap(err, "failed to begin transaction")
+		rollbackSegment := func() {
+			if tx == nil {
+				return
+			}
+			verboseInfo("Rollback transaction")
+			tx.Rollback()
+			tx = nil
 		}
 
-		for _, query := range statements {
-			verboseInfo("Executing statement: %s\n", clearStatement(query))
-			if err = execQuery(tx.Exec, query); err != nil {
-				verboseInfo("Rollback transaction")
-				tx.Rollback()
-				return errors.Wrapf(err, "failed to execute SQL query %q", clearStatement(query))
+		for _, stmt := range statements {
+			verboseInfo("Executing statement: %s\n", clearStatement(stmt.SQL))
+
+			if stmt.NoTx {
+				if err := commitSegment(); err != nil {
+					return err
+				}
+				if err := execQueryContext(ctx, db.ExecContext, stmt.SQL); err != nil {
+					return errors.Wrapf(err, "failed to execute SQL query %q", clearStatement(stmt.SQL))
+				}
+				continue
+			}
+
+			if tx == nil {
+				if err := beginSegment(); err != nil {
+					return err
+				}
+			}
+			if err := execQueryContext(ctx, tx.ExecContext, stmt.SQL); err != nil {
+				rollbackSegment()
+				return errors.Wrapf(err, "failed to execute SQL query %q", clearStatement(stmt.SQL))
 			}
 		}
 
 		if !noVersioning {
+			if tx == nil {
+				if err := beginSegment(); err != nil {
+					return err
+				}
+			}
+
 			if direction {
-				if err := execQuery(tx.Exec, GetDialect().insertVersionSQL(), v, direction); err != nil {
-					verboseInfo("Rollback transaction")
-					tx.Rollback()
+				if err := execQueryContext(ctx, tx.ExecContext, GetDialect().insertVersionSQL(), v, direction); err != nil {
+					rollbackSegment()
 					return errors.Wrap(err, "failed to insert new goose version")
 				}
+				if recorder, ok := checksumRecorder(); ok {
+					checksum := checksumStatements(statements)
+					if err := execQueryContext(ctx, tx.ExecContext, recorder.updateChecksumSQL(), checksum, v); err != nil {
+						rollbackSegment()
+						return errors.Wrap(err, "failed to record migration checksum")
+					}
+				}
 			} else {
-				if err := execQuery(tx.Exec, GetDialect().deleteVersionSQL(), v); err != nil {
-					verboseInfo("Rollback transaction")
-					tx.Rollback()
+				if err := execQueryContext(ctx, tx.ExecContext, GetDialect().deleteVersionSQL(), v); err != nil {
+					rollbackSegment()
 					return errors.Wrap(err, "failed to delete goose version")
 				}
 			}
 		}
 
-		verboseInfo("Commit transaction")
-		if err := tx.Commit(); err != nil {
-			return errors.Wrap(err, "failed to commit transaction")
-		}
-
-		return nil
+		return commitSegment()
 	}
 
 	// NO TRANSACTION.
-	for _, query := range statements {
-		verboseInfo("Executing statement: %s", clearStatement(query))
-		if err := execQuery(db.Exec, query); err != nil {
-			return errors.Wrapf(err, "failed to execute SQL query %q", clearStatement(query))
+	for _, stmt := range statements {
+		verboseInfo("Executing statement: %s", clearStatement(stmt.SQL))
+		if err := execQueryContext(ctx, db.ExecContext, stmt.SQL); err != nil {
+			return errors.Wrapf(err, "failed to execute SQL query %q", clearStatement(stmt.SQL))
 		}
 	}
 	if !noVersioning {
 		if direction {
-			if err := execQuery(db.Exec, GetDialect().insertVersionSQL(), v, direction); err != nil {
+			if err := execQueryContext(ctx, db.ExecContext, GetDialect().insertVersionSQL(), v, direction); err != nil {
 				return errors.Wrap(err, "failed to insert new goose version")
 			}
+			if recorder, ok := checksumRecorder(); ok {
+				checksum := checksumStatements(statements)
+				if err := execQueryContext(ctx, db.ExecContext, recorder.updateChecksumSQL(), checksum, v); err != nil {
+					return errors.Wrap(err, "failed to record migration checksum")
+				}
+			}
 		} else {
-			if err := execQuery(db.Exec, GetDialect().deleteVersionSQL(), v); err != nil {
+			if err := execQueryContext(ctx, db.ExecContext, GetDialect().deleteVersionSQL(), v); err != nil {
 				return errors.Wrap(err, "failed to delete goose version")
 			}
 		}
@@ -82,39 +186,57 @@ func runSQLMigration(db *sql.DB, statements []string, useTx bool, v int64, direc
 	return nil
 }
 
+// execQuery is retained for callers that don't carry a context; it runs
+// the statement via execQueryContext against the background context.
+// fn takes no context, so the statement itself is never cancelled: a
+// timeout set with SetStatementTimeout only makes execQuery stop waiting
+// when verbose is on, and has no effect otherwise.
 func execQuery(fn func(string, ...interface{}) (sql.Result, error), query string, args ...interface{}) error {
+	ctxFn := func(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+		return fn(query, args...)
+	}
+	return execQueryContext(context.Background(), ctxFn, query, args...)
+}
+
+func execQueryContext(ctx context.Context, fn func(context.Context, string, ...interface{}) (sql.Result, error), query string, args ...interface{}) error {
+	if statementTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, statementTimeout)
+		defer cancel()
+	}
+
 	if !verbose {
-		_, err := fn(query, args...)
+		_, err := fn(ctx, query, args...)
 		return err
 	}
 
-	ch := make(chan error)
+	ch := make(chan error, 1)
 
 	go func() {
-		_, err := fn(query, args...)
+		_, err := fn(ctx, query, args...)
 		ch <- err
 	}()
 
 	t := time.Now()
 
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case err := <-ch:
 			return err
-		case <-time.Tick(time.Minute):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
 			verboseInfo("Executing statement still in progress for %v", time.Since(t).Round(time.Second))
 		}
 	}
 }
 
-const (
-	grayColor  = "\033[90m"
-	resetColor = "\033[00m"
-)
-
 func verboseInfo(s string, args ...interface{}) {
 	if verbose {
-		log.Printf(grayColor+s+resetColor, args...)
+		gooseLog.Printf(s, args...)
 	}
 }
 
@@ -0,0 +1,97 @@
+package goose
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	noTransactionAnnotation  = "+goose NO TRANSACTION"
+	statementBeginAnnotation = "+goose STATEMENT BEGIN"
+	statementEndAnnotation   = "+goose STATEMENT END"
+)
+
+// splitStatements splits the raw SQL for one migration direction (the
+// text already isolated between a "-- +goose Up" or "-- +goose Down"
+// directive and the next one) into Statement values, feeding
+// runSQLMigration. Two per-statement annotations are recognized:
+//
+//	-- +goose NO TRANSACTION
+//
+// immediately before a statement pulls it out of the surrounding
+// transaction, so it runs directly against the database connection
+// instead of inside tx. This is for statements Postgres refuses to run
+// inside a transaction block at all, such as CREATE INDEX CONCURRENTLY.
+//
+//	-- +goose STATEMENT BEGIN
+//	...
+//	-- +goose STATEMENT END
+//
+// wraps a block that must not be split on ';', so a multi-line PL/pgSQL
+// function body survives the semicolon splitter below intact.
+func splitStatements(sql string) ([]Statement, error) {
+	var statements []Statement
+	var buf strings.Builder
+	var noTx bool
+	var inStatementBlock bool
+
+	flush := func() {
+		text := strings.TrimSpace(buf.String())
+		if text != "" {
+			statements = append(statements, Statement{SQL: text, NoTx: noTx})
+		}
+		buf.Reset()
+		noTx = false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(sql))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.Contains(trimmed, noTransactionAnnotation):
+			noTx = true
+			continue
+		case strings.Contains(trimmed, statementBeginAnnotation):
+			if inStatementBlock {
+				return nil, errors.New("nested +goose STATEMENT BEGIN")
+			}
+			inStatementBlock = true
+			continue
+		case strings.Contains(trimmed, statementEndAnnotation):
+			if !inStatementBlock {
+				return nil, errors.New("+goose STATEMENT END without matching +goose STATEMENT BEGIN")
+			}
+			inStatementBlock = false
+			flush()
+			continue
+		}
+
+		buf.WriteString(line)
+		buf.WriteString("\n")
+
+		if inStatementBlock {
+			continue
+		}
+
+		if strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to scan migration SQL")
+	}
+
+	if inStatementBlock {
+		return nil, errors.New("+goose STATEMENT BEGIN without matching +goose STATEMENT END")
+	}
+
+	flush()
+
+	return statements, nil
+}
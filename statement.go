@@ -0,0 +1,18 @@
+package goose
+
+// Statement is a single SQL statement parsed out of a migration file,
+// along with the per-statement annotations that apply to it.
+type Statement struct {
+	// SQL is the statement text, including any SQL comments in it. The
+	// "-- +goose" annotation lines splitStatements recognizes are not
+	// kept here; they are recorded as flags instead. Use clearStatement
+	// to strip comments before logging or hashing it.
+	SQL string
+	// NoTx marks a statement annotated with "-- +goose NO TRANSACTION".
+	// It is pulled out of the surrounding transaction and run directly
+	// against the *sql.DB, even when the rest of the file runs inside a
+	// transaction. This is how statements Postgres refuses to run in a
+	// transaction block, such as CREATE INDEX CONCURRENTLY, coexist
+	// with the rest of a migration.
+	NoTx bool
+}